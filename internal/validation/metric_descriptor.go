@@ -0,0 +1,140 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/label"
+	"google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrInvalidMetricDescriptor is the status returned when a MetricDescriptor
+// fails the checks in ValidateMetricDescriptor. Use
+// InvalidMetricDescriptorError to attach the specific rule violations before
+// returning it to the caller.
+var ErrInvalidMetricDescriptor = status.New(codes.InvalidArgument, "metric descriptor failed validation")
+
+var (
+	metricTypeRE = regexp.MustCompile(`^[A-Za-z0-9_/.\-]+$`)
+	labelKeyRE   = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+	unitRE       = regexp.MustCompile(`^[A-Za-z0-9%/.{}\[\]*^]*$`)
+)
+
+const maxLabels = 10
+
+// ValidateMetricDescriptor checks md against the subset of Cloud Monitoring's
+// MetricDescriptor validity rules this mock enforces, returning nil if md is
+// valid or an InvalidArgument error built by InvalidMetricDescriptorError
+// otherwise.
+func ValidateMetricDescriptor(md *metric.MetricDescriptor) error {
+	violations := make(map[string]string)
+
+	validateMetricType(md.GetType(), violations)
+	validateKindAndValueType(md.GetMetricKind(), md.GetValueType(), violations)
+	validateLabels(md.GetLabels(), violations)
+	validateUnit(md.GetUnit(), violations)
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return InvalidMetricDescriptorError(violations)
+}
+
+func validateMetricType(typ string, violations map[string]string) {
+	switch {
+	case typ == "":
+		violations["Type"] = "type is required"
+	case !metricTypeRE.MatchString(typ):
+		violations["Type"] = "type must match ^[A-Za-z0-9_/.-]+$"
+	case !strings.Contains(typ, "/"):
+		violations["Type"] = `type must contain a "/", e.g. "custom.googleapis.com/foo"`
+	}
+}
+
+func validateKindAndValueType(kind metric.MetricDescriptor_MetricKind, valueType metric.MetricDescriptor_ValueType, violations map[string]string) {
+	switch kind {
+	case metric.MetricDescriptor_GAUGE, metric.MetricDescriptor_DELTA, metric.MetricDescriptor_CUMULATIVE:
+		// valid
+	default:
+		violations["MetricKind"] = "metric_kind must be GAUGE, DELTA, or CUMULATIVE"
+	}
+
+	if valueType == metric.MetricDescriptor_VALUE_TYPE_UNSPECIFIED {
+		violations["ValueType"] = "value_type is required"
+		return
+	}
+
+	switch {
+	case valueType == metric.MetricDescriptor_DISTRIBUTION && kind != metric.MetricDescriptor_DELTA && kind != metric.MetricDescriptor_CUMULATIVE:
+		violations["ValueType"] = "DISTRIBUTION value_type requires a DELTA or CUMULATIVE metric_kind"
+	case (valueType == metric.MetricDescriptor_STRING || valueType == metric.MetricDescriptor_BOOL) && kind == metric.MetricDescriptor_CUMULATIVE:
+		violations["ValueType"] = fmt.Sprintf("%s value_type is incompatible with a CUMULATIVE metric_kind", valueType)
+	}
+}
+
+func validateLabels(labels []*label.LabelDescriptor, violations map[string]string) {
+	if len(labels) > maxLabels {
+		violations["Labels"] = fmt.Sprintf("at most %d labels are allowed, got %d", maxLabels, len(labels))
+	}
+
+	seen := make(map[string]struct{}, len(labels))
+	for _, l := range labels {
+		key := l.GetKey()
+		if !labelKeyRE.MatchString(key) {
+			violations["Labels"] = fmt.Sprintf("label key %q must match ^[a-zA-Z][a-zA-Z0-9_]*$", key)
+			continue
+		}
+		if _, dup := seen[key]; dup {
+			violations["Labels"] = fmt.Sprintf("duplicate label key %q", key)
+			continue
+		}
+		seen[key] = struct{}{}
+	}
+}
+
+func validateUnit(unit string, violations map[string]string) {
+	if unit == "" {
+		return
+	}
+	if !unitRE.MatchString(unit) {
+		violations["Unit"] = fmt.Sprintf("unit %q is not a valid UCUM unit token", unit)
+	}
+}
+
+// InvalidMetricDescriptorError builds the InvalidArgument error for a
+// MetricDescriptor that failed validation, attaching one BadRequest field
+// violation per rule in violations (a field name to human-readable
+// description), mirroring the ErrMissingField pattern.
+func InvalidMetricDescriptorError(violations map[string]string) error {
+	fieldViolations := make([]*errdetails.BadRequest_FieldViolation, 0, len(violations))
+	for field, description := range violations {
+		fieldViolations = append(fieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: description,
+		})
+	}
+
+	withDetails, err := ErrInvalidMetricDescriptor.WithDetails(&errdetails.BadRequest{FieldViolations: fieldViolations})
+	if err != nil {
+		return ErrInvalidMetricDescriptor.Err()
+	}
+	return withDetails.Err()
+}
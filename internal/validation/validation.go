@@ -0,0 +1,199 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package validation holds the request-validation helpers shared by the mock
+// servers, and the canonical gRPC statuses they return.
+package validation
+
+import (
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrMissingField is the status returned when a request is missing one or
+	// more required fields. Use MissingFieldsError to attach field-level
+	// detail before returning it to the caller.
+	ErrMissingField = status.New(codes.InvalidArgument, "one or more fields in the request is missing or misformatted")
+
+	// StatusMetricDescriptorNotFound is returned when a MetricDescriptor
+	// lookup (Get/Delete) finds no match for the requested name.
+	StatusMetricDescriptorNotFound = status.New(codes.NotFound, "metric descriptor not found")
+
+	// StatusDuplicateMetricDescriptorName is returned when
+	// CreateMetricDescriptor is called with a name that already exists.
+	StatusDuplicateMetricDescriptorName = status.New(codes.AlreadyExists, "a metric descriptor with this name already exists")
+
+	// StatusMissingAPIClientHeader is returned when a server opted into
+	// WithRequireAPIClientHeader receives a call whose x-goog-api-client
+	// metadata is absent or doesn't match any accepted prefix.
+	StatusMissingAPIClientHeader = status.New(codes.FailedPrecondition, "x-goog-api-client metadata is missing or does not match an accepted client library prefix")
+
+	// StatusInvalidPageToken is returned when a List* call's PageToken
+	// cannot be decoded.
+	StatusInvalidPageToken = status.New(codes.InvalidArgument, "page_token is invalid or corrupt")
+
+	// StatusMismatchedPageFilter is returned when a List* call's PageToken
+	// was issued for a page sequence started with a different filter.
+	StatusMismatchedPageFilter = status.New(codes.InvalidArgument, "filter must not change between calls paginating the same request")
+)
+
+// MissingFieldsError builds the error returned for a request that failed
+// required-field validation. present maps each required field's name to
+// whether it was set on the request; fields with a false value are reported
+// as missing via a BadRequest field violation detail.
+func MissingFieldsError(present map[string]bool) error {
+	var violations []*errdetails.BadRequest_FieldViolation
+	for field, ok := range present {
+		if ok {
+			continue
+		}
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: "this field is required",
+		})
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	withDetails, err := ErrMissingField.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return ErrMissingField.Err()
+	}
+	return withDetails.Err()
+}
+
+// ValidateErrDetails reports whether err is a status (such as a
+// MissingFieldsError or InvalidMetricDescriptorError) whose BadRequest field
+// violations exactly match wantFields.
+func ValidateErrDetails(err error, wantFields map[string]struct{}) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+
+	gotFields := make(map[string]struct{})
+	for _, detail := range s.Details() {
+		br, ok := detail.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+		for _, violation := range br.GetFieldViolations() {
+			gotFields[violation.GetField()] = struct{}{}
+		}
+	}
+
+	if len(gotFields) != len(wantFields) {
+		return false
+	}
+	for field := range wantFields {
+		if _, ok := gotFields[field]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// DuplicateMetricDescriptorNameError builds the AlreadyExists status for a
+// CreateMetricDescriptor call that collides with an existing descriptor,
+// attaching the offending name so callers can assert on it.
+func DuplicateMetricDescriptorNameError(name string) error {
+	withDetails, err := StatusDuplicateMetricDescriptorName.WithDetails(&errdetails.ResourceInfo{
+		ResourceType: "metric_descriptor",
+		ResourceName: name,
+	})
+	if err != nil {
+		return StatusDuplicateMetricDescriptorName.Err()
+	}
+	return withDetails.Err()
+}
+
+// DuplicateMetricDescriptorConfigChangedError builds the AlreadyExists status
+// for a CreateMetricDescriptor call that reuses an existing descriptor's name
+// but changes its MetricKind or ValueType, which production Monitoring
+// forbids even though a plain name collision with the same configuration
+// would already be rejected by DuplicateMetricDescriptorNameError.
+func DuplicateMetricDescriptorConfigChangedError(name string) error {
+	withDetails, err := StatusDuplicateMetricDescriptorName.WithDetails(&errdetails.ResourceInfo{
+		ResourceType: "metric_descriptor",
+		ResourceName: name,
+		Description:  "cannot change MetricKind or ValueType of an existing metric descriptor",
+	})
+	if err != nil {
+		return StatusDuplicateMetricDescriptorName.Err()
+	}
+	return withDetails.Err()
+}
+
+// MissingAPIClientHeaderError builds the FailedPrecondition error for a call
+// rejected by WithRequireAPIClientHeader, attaching the accepted prefixes as
+// an ErrorInfo detail so callers can see what was expected.
+func MissingAPIClientHeaderError(acceptedPrefixes []string) error {
+	withDetails, err := StatusMissingAPIClientHeader.WithDetails(&errdetails.ErrorInfo{
+		Reason: "MISSING_API_CLIENT_HEADER",
+		Metadata: map[string]string{
+			"accepted_prefixes": strings.Join(acceptedPrefixes, ", "),
+		},
+	})
+	if err != nil {
+		return StatusMissingAPIClientHeader.Err()
+	}
+	return withDetails.Err()
+}
+
+// ValidateDuplicateSpanNames reports whether err carries a ResourceInfo
+// detail naming the given duplicate metric descriptor name.
+//
+// The name "spans" is inherited from the sibling trace server, whose
+// duplicate-name checks share this same detail shape.
+func ValidateDuplicateSpanNames(err error, name string) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	for _, detail := range s.Details() {
+		info, ok := detail.(*errdetails.ResourceInfo)
+		if !ok {
+			continue
+		}
+		if info.GetResourceName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateDuplicateMetricDescriptorConfigChanged reports whether err is a
+// DuplicateMetricDescriptorConfigChangedError for the given name, as opposed
+// to a plain DuplicateMetricDescriptorNameError.
+func ValidateDuplicateMetricDescriptorConfigChanged(err error, name string) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	for _, detail := range s.Details() {
+		info, ok := detail.(*errdetails.ResourceInfo)
+		if !ok {
+			continue
+		}
+		if info.GetResourceName() == name && info.GetDescription() != "" {
+			return true
+		}
+	}
+	return false
+}
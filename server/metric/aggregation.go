@@ -0,0 +1,222 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// applyAggregation aligns each series' points into per-series buckets sized
+// by agg.AlignmentPeriod (reduced with agg.PerSeriesAligner), then, if
+// agg.CrossSeriesReducer is set, combines series sharing the same
+// agg.GroupByFields values into a single series per group.
+//
+// A nil or zero-value Aggregation is a no-op.
+func applyAggregation(series []*monitoring.TimeSeries, agg *monitoring.Aggregation) []*monitoring.TimeSeries {
+	if agg == nil {
+		return series
+	}
+
+	if agg.GetAlignmentPeriod() != nil && agg.GetPerSeriesAligner() != monitoring.Aggregation_ALIGN_NONE {
+		for _, ts := range series {
+			ts.Points = alignPoints(ts.GetPoints(), agg.GetAlignmentPeriod().AsDuration(), agg.GetPerSeriesAligner())
+		}
+	}
+
+	if agg.GetCrossSeriesReducer() == monitoring.Aggregation_REDUCE_NONE {
+		return series
+	}
+	return reduceAcrossSeries(series, agg.GetCrossSeriesReducer(), agg.GetGroupByFields())
+}
+
+// alignPoints buckets points into period-sized windows (keyed by the start
+// of the window each point's end time falls in) and reduces each bucket with
+// aligner.
+func alignPoints(points []*monitoring.Point, period time.Duration, aligner monitoring.Aggregation_Aligner) []*monitoring.Point {
+	periodSeconds := int64(period / time.Second)
+	if periodSeconds <= 0 {
+		return points
+	}
+
+	buckets := make(map[int64][]*monitoring.Point)
+	var order []int64
+	for _, p := range points {
+		t := p.GetInterval().GetEndTime().AsTime().Unix()
+		bucket := (t / periodSeconds) * periodSeconds
+		if _, ok := buckets[bucket]; !ok {
+			order = append(order, bucket)
+		}
+		buckets[bucket] = append(buckets[bucket], p)
+	}
+
+	aligned := make([]*monitoring.Point, 0, len(order))
+	for _, bucket := range order {
+		aligned = append(aligned, reducePoints(buckets[bucket], aligner))
+	}
+	return aligned
+}
+
+// reducePoints collapses a bucket of points into one, per the aligner's
+// reduction function. Only the double/int64 value kinds used in this mock's
+// tests are handled; anything else keeps the bucket's first point
+// unmodified, matching ALIGN_NONE.
+func reducePoints(points []*monitoring.Point, aligner monitoring.Aggregation_Aligner) *monitoring.Point {
+	if (len(points) == 1 && aligner != monitoring.Aggregation_ALIGN_COUNT) || aligner == monitoring.Aggregation_ALIGN_NONE {
+		return points[0]
+	}
+
+	values := make([]float64, 0, len(points))
+	for _, p := range points {
+		switch p.GetValue().GetValue().(type) {
+		case *monitoring.TypedValue_DoubleValue, *monitoring.TypedValue_Int64Value:
+		default:
+			return points[0]
+		}
+		values = append(values, pointValue(p))
+	}
+
+	var result float64
+	switch aligner {
+	case monitoring.Aggregation_ALIGN_SUM:
+		for _, v := range values {
+			result += v
+		}
+	case monitoring.Aggregation_ALIGN_MEAN:
+		for _, v := range values {
+			result += v
+		}
+		result /= float64(len(values))
+	case monitoring.Aggregation_ALIGN_MAX:
+		result = values[0]
+		for _, v := range values[1:] {
+			if v > result {
+				result = v
+			}
+		}
+	case monitoring.Aggregation_ALIGN_MIN:
+		result = values[0]
+		for _, v := range values[1:] {
+			if v < result {
+				result = v
+			}
+		}
+	case monitoring.Aggregation_ALIGN_COUNT:
+		result = float64(len(values))
+	default:
+		return points[0]
+	}
+
+	return &monitoring.Point{
+		Interval: points[len(points)-1].GetInterval(),
+		Value:    &monitoring.TypedValue{Value: &monitoring.TypedValue_DoubleValue{DoubleValue: result}},
+	}
+}
+
+func pointValue(p *monitoring.Point) float64 {
+	switch v := p.GetValue().GetValue().(type) {
+	case *monitoring.TypedValue_DoubleValue:
+		return v.DoubleValue
+	case *monitoring.TypedValue_Int64Value:
+		return float64(v.Int64Value)
+	default:
+		return 0
+	}
+}
+
+// reduceAcrossSeries groups series by the values of groupBy (drawn from
+// resource and metric labels) and collapses each group's aligned points into
+// a single series per group, using the same reduction semantics as
+// reducePoints.
+func reduceAcrossSeries(series []*monitoring.TimeSeries, reducer monitoring.Aggregation_Reducer, groupBy []string) []*monitoring.TimeSeries {
+	groups := make(map[string][]*monitoring.TimeSeries)
+	var order []string
+	for _, ts := range series {
+		key := groupKey(ts, groupBy)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], ts)
+	}
+
+	reduced := make([]*monitoring.TimeSeries, 0, len(order))
+	for _, key := range order {
+		group := groups[key]
+		if len(group) == 1 && reducer != monitoring.Aggregation_REDUCE_COUNT {
+			reduced = append(reduced, group[0])
+			continue
+		}
+
+		byTime := make(map[int64][]*monitoring.Point)
+		var times []int64
+		for _, ts := range group {
+			for _, p := range ts.GetPoints() {
+				t := p.GetInterval().GetEndTime().AsTime().Unix()
+				if _, ok := byTime[t]; !ok {
+					times = append(times, t)
+				}
+				byTime[t] = append(byTime[t], p)
+			}
+		}
+
+		merged := &monitoring.TimeSeries{
+			Metric:     group[0].GetMetric(),
+			Resource:   group[0].GetResource(),
+			MetricKind: group[0].GetMetricKind(),
+			ValueType:  group[0].GetValueType(),
+		}
+		for _, t := range times {
+			merged.Points = append(merged.Points, reducePoints(byTime[t], alignerForReducer(reducer)))
+		}
+		reduced = append(reduced, merged)
+	}
+	return reduced
+}
+
+// alignerForReducer maps a cross-series reducer onto the equivalent
+// per-series aligner, so the two can share reducePoints.
+func alignerForReducer(reducer monitoring.Aggregation_Reducer) monitoring.Aggregation_Aligner {
+	switch reducer {
+	case monitoring.Aggregation_REDUCE_SUM:
+		return monitoring.Aggregation_ALIGN_SUM
+	case monitoring.Aggregation_REDUCE_MEAN:
+		return monitoring.Aggregation_ALIGN_MEAN
+	case monitoring.Aggregation_REDUCE_MAX:
+		return monitoring.Aggregation_ALIGN_MAX
+	case monitoring.Aggregation_REDUCE_MIN:
+		return monitoring.Aggregation_ALIGN_MIN
+	case monitoring.Aggregation_REDUCE_COUNT:
+		return monitoring.Aggregation_ALIGN_COUNT
+	default:
+		return monitoring.Aggregation_ALIGN_NONE
+	}
+}
+
+func groupKey(ts *monitoring.TimeSeries, groupBy []string) string {
+	var b strings.Builder
+	for _, field := range groupBy {
+		label := strings.TrimPrefix(strings.TrimPrefix(field, "resource.labels."), "metric.labels.")
+		switch {
+		case strings.HasPrefix(field, "resource.labels."):
+			b.WriteString(ts.GetResource().GetLabels()[label])
+		case strings.HasPrefix(field, "metric.labels."):
+			b.WriteString(ts.GetMetric().GetLabels()[label])
+		}
+		b.WriteByte('\x00')
+	}
+	return b.String()
+}
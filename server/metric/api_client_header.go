@@ -0,0 +1,87 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"context"
+	"strings"
+
+	"github.com/googleinterns/cloud-operations-api-mock/internal/validation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const apiClientHeader = "x-goog-api-client"
+
+// defaultAPIClientPrefixes is used by WithRequireAPIClientHeader when called
+// with no prefixes, covering the official Google client libraries' gRPC
+// transports.
+var defaultAPIClientPrefixes = []string{"gl-go/", "gccl/", "gapic/"}
+
+// Option configures a MockMetricServer at construction time.
+type Option func(*MockMetricServer)
+
+// WithRequireAPIClientHeader opts the server into rejecting any call whose
+// x-goog-api-client metadata is missing or doesn't carry a space-separated
+// token starting with one of prefixes, catching clients that bypass the
+// official Google auth/transport stack. With no prefixes given it defaults
+// to gl-go/, gccl/, and gapic/.
+func WithRequireAPIClientHeader(prefixes ...string) Option {
+	if len(prefixes) == 0 {
+		prefixes = defaultAPIClientPrefixes
+	}
+	return func(s *MockMetricServer) {
+		s.requireAPIClientHeader = true
+		s.apiClientPrefixes = prefixes
+	}
+}
+
+// UnaryInterceptor returns a grpc.UnaryServerInterceptor enforcing this
+// server's options that apply across every RPC (currently just
+// WithRequireAPIClientHeader). Register it alongside
+// monitoring.RegisterMetricServiceServer:
+//
+//	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(mockServer.UnaryInterceptor()))
+func (s *MockMetricServer) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if s.requireAPIClientHeader {
+			if err := checkAPIClientHeader(ctx, s.apiClientPrefixes); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// checkAPIClientHeader reports an error unless ctx carries an
+// x-goog-api-client metadata value with a space-separated token starting
+// with one of prefixes. A real header carries multiple tokens (e.g.
+// "grpc/1.31.0 gl-go/1.19.0"), so the whole value can't be matched with a
+// single HasPrefix check.
+func checkAPIClientHeader(ctx context.Context, prefixes []string) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		for _, value := range md.Get(apiClientHeader) {
+			for _, token := range strings.Fields(value) {
+				for _, prefix := range prefixes {
+					if strings.HasPrefix(token, prefix) {
+						return nil
+					}
+				}
+			}
+		}
+	}
+	return validation.MissingAPIClientHeaderError(prefixes)
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// FaultInjector lets tests configure errors and latency to be returned from
+// a MockMetricServer's RPC handlers, so that clients can be exercised for
+// retry, backoff, and caching behavior without a real Monitoring backend
+// misbehaving on demand. Call a MockMetricServer's Faults method to reach
+// its injector.
+type FaultInjector struct {
+	mu sync.Mutex
+
+	nextErrors map[string]*nextError
+	latencies  map[string]time.Duration
+	errorRates map[string]errorRate
+	callCounts map[string]int
+}
+
+type nextError struct {
+	status    *status.Status
+	remaining int
+}
+
+type errorRate struct {
+	fraction float64
+	status   *status.Status
+}
+
+func newFaultInjector() *FaultInjector {
+	return &FaultInjector{
+		nextErrors: make(map[string]*nextError),
+		latencies:  make(map[string]time.Duration),
+		errorRates: make(map[string]errorRate),
+		callCounts: make(map[string]int),
+	}
+}
+
+// SetNextError causes the next count calls to method to fail with err
+// instead of running the handler, regardless of what the request contains.
+// err can carry arbitrary details (e.g. an errdetails.RetryInfo) via
+// status.WithDetails before being passed in.
+func (f *FaultInjector) SetNextError(method string, err *status.Status, count int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if count <= 0 {
+		delete(f.nextErrors, method)
+		return
+	}
+	f.nextErrors[method] = &nextError{status: err, remaining: count}
+}
+
+// SetLatency causes every future call to method to sleep for d before
+// running the handler.
+func (f *FaultInjector) SetLatency(method string, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latencies[method] = d
+}
+
+// SetErrorRate causes calls to method to fail with err at random, roughly a
+// fraction of the time (0 disables the rate, 1 always fails).
+func (f *FaultInjector) SetErrorRate(method string, fraction float64, err *status.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errorRates[method] = errorRate{fraction: fraction, status: err}
+}
+
+// CallCount reports how many times method has been intercepted so far,
+// regardless of whether a fault fired.
+func (f *FaultInjector) CallCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.callCounts[method]
+}
+
+// intercept records a call to method and, if a configured fault applies,
+// returns the error the handler should return in place of its normal result.
+// It also blocks for any configured latency before returning.
+func (f *FaultInjector) intercept(method string) error {
+	f.mu.Lock()
+	f.callCounts[method]++
+
+	latency, hasLatency := f.latencies[method]
+
+	if next, ok := f.nextErrors[method]; ok {
+		next.remaining--
+		if next.remaining <= 0 {
+			delete(f.nextErrors, method)
+		}
+		f.mu.Unlock()
+		if hasLatency {
+			time.Sleep(latency)
+		}
+		return next.status.Err()
+	}
+
+	rate, hasRate := f.errorRates[method]
+	f.mu.Unlock()
+
+	if hasLatency {
+		time.Sleep(latency)
+	}
+
+	if hasRate && rate.fraction > 0 && rand.Float64() < rate.fraction {
+		return rate.status.Err()
+	}
+	return nil
+}
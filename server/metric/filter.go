@@ -0,0 +1,106 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"strings"
+
+	"google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// filterClause is one "key = \"value\"" clause of a Monitoring filter
+// expression.
+type filterClause struct {
+	key   string
+	value string
+}
+
+// parseFilter parses the minimal subset of the Monitoring filter language
+// this mock supports: clauses of the form `key = "value"` ANDed together,
+// where key is one of metric.type, resource.type, metric.labels.<name> or
+// resource.labels.<name>. Clauses it doesn't recognize are ignored rather
+// than rejected, since this mock only needs to approximate filtering, not
+// fully validate the filter grammar.
+func parseFilter(filter string) []filterClause {
+	var clauses []filterClause
+	for _, part := range strings.Split(filter, " AND ") {
+		eq := strings.Index(part, "=")
+		if eq < 0 {
+			continue
+		}
+		key := strings.TrimSpace(part[:eq])
+		value := strings.TrimSpace(part[eq+1:])
+		value = strings.Trim(value, `"`)
+		if key == "" {
+			continue
+		}
+		clauses = append(clauses, filterClause{key: key, value: value})
+	}
+	return clauses
+}
+
+// matchesFilter reports whether ts satisfies every clause.
+func matchesFilter(ts *monitoring.TimeSeries, clauses []filterClause) bool {
+	for _, c := range clauses {
+		switch {
+		case c.key == "metric.type":
+			if ts.GetMetric().GetType() != c.value {
+				return false
+			}
+		case c.key == "resource.type":
+			if ts.GetResource().GetType() != c.value {
+				return false
+			}
+		case strings.HasPrefix(c.key, "metric.labels."):
+			label := strings.TrimPrefix(c.key, "metric.labels.")
+			if ts.GetMetric().GetLabels()[label] != c.value {
+				return false
+			}
+		case strings.HasPrefix(c.key, "resource.labels."):
+			label := strings.TrimPrefix(c.key, "resource.labels.")
+			if ts.GetResource().GetLabels()[label] != c.value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// truncateToInterval returns a copy of ts with only the points whose
+// timestamps fall within [interval.StartTime, interval.EndTime]. An unset
+// (nil) StartTime or EndTime leaves that bound unconstrained.
+func truncateToInterval(ts *monitoring.TimeSeries, interval *monitoring.TimeInterval) *monitoring.TimeSeries {
+	out := &monitoring.TimeSeries{
+		Metric:     ts.GetMetric(),
+		Resource:   ts.GetResource(),
+		Metadata:   ts.GetMetadata(),
+		MetricKind: ts.GetMetricKind(),
+		ValueType:  ts.GetValueType(),
+	}
+
+	start := interval.GetStartTime()
+	end := interval.GetEndTime()
+	for _, p := range ts.GetPoints() {
+		t := p.GetInterval().GetEndTime()
+		if start != nil && t != nil && t.AsTime().Before(start.AsTime()) {
+			continue
+		}
+		if end != nil && t != nil && t.AsTime().After(end.AsTime()) {
+			continue
+		}
+		out.Points = append(out.Points, p)
+	}
+	return out
+}
@@ -0,0 +1,394 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metric implements a mock of the Cloud Monitoring v3 MetricService,
+// backed by an in-memory store instead of a real Monitoring backend.
+package metric
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/googleinterns/cloud-operations-api-mock/internal/validation"
+	"google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/genproto/googleapis/rpc/status"
+)
+
+// MockMetricServer implements monitoring.MetricServiceServer over an
+// in-memory store, so that client libraries can be exercised against
+// something more than an empty-response smoke test.
+type MockMetricServer struct {
+	mu sync.Mutex
+
+	metricDescriptors            map[string]*metric.MetricDescriptor
+	monitoredResourceDescriptors map[string]*monitoredres.MonitoredResourceDescriptor
+
+	// timeSeries accumulates every point ever written via CreateTimeSeries,
+	// keyed by the identifying labels of the series (metric type, resource
+	// type, resource labels, metric labels) so that repeated writes to the
+	// same series append rather than overwrite.
+	timeSeries map[string]*monitoring.TimeSeries
+
+	faults *FaultInjector
+
+	requireAPIClientHeader bool
+	apiClientPrefixes      []string
+
+	maxPageSize int32
+}
+
+// NewMockMetricServer creates a MockMetricServer with empty backing stores,
+// applying any options given.
+func NewMockMetricServer(opts ...Option) *MockMetricServer {
+	s := &MockMetricServer{
+		metricDescriptors:            make(map[string]*metric.MetricDescriptor),
+		monitoredResourceDescriptors: make(map[string]*monitoredres.MonitoredResourceDescriptor),
+		timeSeries:                   make(map[string]*monitoring.TimeSeries),
+		faults:                       newFaultInjector(),
+		maxPageSize:                  defaultMaxPageSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Faults returns the FaultInjector governing this server's RPC handlers, so
+// tests can configure errors and latency before driving a client against it.
+func (s *MockMetricServer) Faults() *FaultInjector {
+	return s.faults
+}
+
+// CreateTimeSeries writes each TimeSeries' points into the in-memory store,
+// merging them into whatever points already exist for that series.
+func (s *MockMetricServer) CreateTimeSeries(ctx context.Context, req *monitoring.CreateTimeSeriesRequest) (*empty.Empty, error) {
+	if err := s.faults.intercept("CreateTimeSeries"); err != nil {
+		return nil, err
+	}
+
+	if err := validation.MissingFieldsError(map[string]bool{
+		"Name":       req.GetName() != "",
+		"TimeSeries": len(req.GetTimeSeries()) > 0,
+	}); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ts := range req.GetTimeSeries() {
+		key := seriesFingerprint(ts)
+		existing, ok := s.timeSeries[key]
+		if !ok {
+			s.timeSeries[key] = ts
+			continue
+		}
+		existing.Points = append(existing.Points, ts.GetPoints()...)
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// ListTimeSeries returns the stored series matching the request's filter,
+// truncated to the requested Interval, aligned/reduced per Aggregation, and
+// stripped of Points when View is HEADERS.
+func (s *MockMetricServer) ListTimeSeries(ctx context.Context, req *monitoring.ListTimeSeriesRequest) (*monitoring.ListTimeSeriesResponse, error) {
+	if err := s.faults.intercept("ListTimeSeries"); err != nil {
+		return nil, err
+	}
+
+	if err := validation.MissingFieldsError(map[string]bool{
+		"Name":     req.GetName() != "",
+		"Filter":   req.GetFilter() != "",
+		"Interval": req.GetInterval() != nil,
+	}); err != nil {
+		return nil, err
+	}
+
+	state, err := resolvePageToken(req.GetPageToken(), req.GetFilter())
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clauses := parseFilter(req.GetFilter())
+
+	matchedKeys := make([]string, 0, len(s.timeSeries))
+	for key, ts := range s.timeSeries {
+		if matchesFilter(ts, clauses) {
+			matchedKeys = append(matchedKeys, key)
+		}
+	}
+	sort.Strings(matchedKeys)
+
+	aggregated := make([]*monitoring.TimeSeries, 0, len(matchedKeys))
+	for _, key := range matchedKeys {
+		aggregated = append(aggregated, truncateToInterval(s.timeSeries[key], req.GetInterval()))
+	}
+	aggregated = applyAggregation(aggregated, req.GetAggregation())
+
+	// Aggregation (in particular a CrossSeriesReducer) can merge several
+	// matched series into one, so the result no longer lines up with
+	// matchedKeys one-to-one; paginate must run over aggregated's own
+	// ordinal positions rather than the pre-aggregation keys, or a
+	// reducer's group could be split across page boundaries.
+	resultKeys := make([]string, len(aggregated))
+	resultByKey := make(map[string]*monitoring.TimeSeries, len(aggregated))
+	for i, ts := range aggregated {
+		key := fmt.Sprintf("%08d", i)
+		resultKeys[i] = key
+		resultByKey[key] = ts
+	}
+
+	pageKeys, nextToken := paginate(resultKeys, state, req.GetPageSize(), s.maxPageSize, req.GetFilter())
+
+	matched := make([]*monitoring.TimeSeries, 0, len(pageKeys))
+	for _, key := range pageKeys {
+		matched = append(matched, resultByKey[key])
+	}
+
+	if req.GetView() == monitoring.ListTimeSeriesRequest_HEADERS {
+		for _, ts := range matched {
+			ts.Points = nil
+		}
+	}
+
+	return &monitoring.ListTimeSeriesResponse{
+		TimeSeries:      matched,
+		NextPageToken:   nextToken,
+		ExecutionErrors: []*status.Status{},
+	}, nil
+}
+
+// GetMonitoredResourceDescriptor returns the descriptor registered under
+// req.Name, or a zero-value descriptor if none has been registered: monitored
+// resource descriptors are predefined by Monitoring rather than created
+// through this API, so an unknown name is not an error.
+func (s *MockMetricServer) GetMonitoredResourceDescriptor(ctx context.Context, req *monitoring.GetMonitoredResourceDescriptorRequest) (*monitoredres.MonitoredResourceDescriptor, error) {
+	if err := s.faults.intercept("GetMonitoredResourceDescriptor"); err != nil {
+		return nil, err
+	}
+
+	if err := validation.MissingFieldsError(map[string]bool{
+		"Name": req.GetName() != "",
+	}); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d, ok := s.monitoredResourceDescriptors[req.GetName()]; ok {
+		return d, nil
+	}
+	return &monitoredres.MonitoredResourceDescriptor{}, nil
+}
+
+// ListMonitoredResourceDescriptors returns one page of the registered
+// monitored resource descriptors, ordered by name.
+func (s *MockMetricServer) ListMonitoredResourceDescriptors(ctx context.Context, req *monitoring.ListMonitoredResourceDescriptorsRequest) (*monitoring.ListMonitoredResourceDescriptorsResponse, error) {
+	if err := s.faults.intercept("ListMonitoredResourceDescriptors"); err != nil {
+		return nil, err
+	}
+
+	if err := validation.MissingFieldsError(map[string]bool{
+		"Name": req.GetName() != "",
+	}); err != nil {
+		return nil, err
+	}
+
+	state, err := resolvePageToken(req.GetPageToken(), req.GetFilter())
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.monitoredResourceDescriptors))
+	for key := range s.monitoredResourceDescriptors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pageKeys, nextToken := paginate(keys, state, req.GetPageSize(), s.maxPageSize, req.GetFilter())
+
+	descriptors := make([]*monitoredres.MonitoredResourceDescriptor, 0, len(pageKeys))
+	for _, key := range pageKeys {
+		descriptors = append(descriptors, s.monitoredResourceDescriptors[key])
+	}
+
+	return &monitoring.ListMonitoredResourceDescriptorsResponse{
+		ResourceDescriptors: descriptors,
+		NextPageToken:       nextToken,
+	}, nil
+}
+
+// GetMetricDescriptor returns the descriptor registered under req.Name, or
+// StatusMetricDescriptorNotFound if none exists.
+func (s *MockMetricServer) GetMetricDescriptor(ctx context.Context, req *monitoring.GetMetricDescriptorRequest) (*metric.MetricDescriptor, error) {
+	if err := s.faults.intercept("GetMetricDescriptor"); err != nil {
+		return nil, err
+	}
+
+	if err := validation.MissingFieldsError(map[string]bool{
+		"Name": req.GetName() != "",
+	}); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.metricDescriptors[req.GetName()]
+	if !ok {
+		return nil, validation.StatusMetricDescriptorNotFound.Err()
+	}
+	return d, nil
+}
+
+// CreateMetricDescriptor registers req.MetricDescriptor, keyed by its own
+// Name, rejecting the call if that name is already taken.
+func (s *MockMetricServer) CreateMetricDescriptor(ctx context.Context, req *monitoring.CreateMetricDescriptorRequest) (*metric.MetricDescriptor, error) {
+	if err := s.faults.intercept("CreateMetricDescriptor"); err != nil {
+		return nil, err
+	}
+
+	if err := validation.MissingFieldsError(map[string]bool{
+		"Name":             req.GetName() != "",
+		"MetricDescriptor": req.GetMetricDescriptor() != nil,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := validation.ValidateMetricDescriptor(req.GetMetricDescriptor()); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	incoming := req.GetMetricDescriptor()
+	name := incoming.GetName()
+	if existing, ok := s.metricDescriptors[name]; ok {
+		if existing.GetMetricKind() != incoming.GetMetricKind() || existing.GetValueType() != incoming.GetValueType() {
+			return nil, validation.DuplicateMetricDescriptorConfigChangedError(name)
+		}
+		return nil, validation.DuplicateMetricDescriptorNameError(name)
+	}
+
+	s.metricDescriptors[name] = incoming
+	return incoming, nil
+}
+
+// DeleteMetricDescriptor removes the descriptor registered under req.Name,
+// or returns StatusMetricDescriptorNotFound if none exists.
+func (s *MockMetricServer) DeleteMetricDescriptor(ctx context.Context, req *monitoring.DeleteMetricDescriptorRequest) (*empty.Empty, error) {
+	if err := s.faults.intercept("DeleteMetricDescriptor"); err != nil {
+		return nil, err
+	}
+
+	if err := validation.MissingFieldsError(map[string]bool{
+		"Name": req.GetName() != "",
+	}); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.metricDescriptors[req.GetName()]; !ok {
+		return nil, validation.StatusMetricDescriptorNotFound.Err()
+	}
+	delete(s.metricDescriptors, req.GetName())
+
+	return &empty.Empty{}, nil
+}
+
+// ListMetricDescriptors returns one page of the registered metric
+// descriptors, ordered by name.
+func (s *MockMetricServer) ListMetricDescriptors(ctx context.Context, req *monitoring.ListMetricDescriptorsRequest) (*monitoring.ListMetricDescriptorsResponse, error) {
+	if err := s.faults.intercept("ListMetricDescriptors"); err != nil {
+		return nil, err
+	}
+
+	if err := validation.MissingFieldsError(map[string]bool{
+		"Name": req.GetName() != "",
+	}); err != nil {
+		return nil, err
+	}
+
+	state, err := resolvePageToken(req.GetPageToken(), req.GetFilter())
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.metricDescriptors))
+	for key := range s.metricDescriptors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pageKeys, nextToken := paginate(keys, state, req.GetPageSize(), s.maxPageSize, req.GetFilter())
+
+	descriptors := make([]*metric.MetricDescriptor, 0, len(pageKeys))
+	for _, key := range pageKeys {
+		descriptors = append(descriptors, s.metricDescriptors[key])
+	}
+
+	return &monitoring.ListMetricDescriptorsResponse{
+		MetricDescriptors: descriptors,
+		NextPageToken:     nextToken,
+	}, nil
+}
+
+// seriesFingerprint identifies a TimeSeries by its metric type, resource
+// type, and both label sets, matching how Monitoring treats these fields as
+// together defining "the same series".
+func seriesFingerprint(ts *monitoring.TimeSeries) string {
+	var b strings.Builder
+	b.WriteString(ts.GetMetric().GetType())
+	b.WriteByte('\x00')
+	b.WriteString(ts.GetResource().GetType())
+	b.WriteByte('\x00')
+	writeSortedLabels(&b, ts.GetResource().GetLabels())
+	b.WriteByte('\x00')
+	writeSortedLabels(&b, ts.GetMetric().GetLabels())
+	return b.String()
+}
+
+func writeSortedLabels(b *strings.Builder, labels map[string]string) {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+		b.WriteByte(',')
+	}
+}
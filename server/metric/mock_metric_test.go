@@ -16,22 +16,29 @@ package metric
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/googleinterns/cloud-operations-api-mock/internal/validation"
+	"google.golang.org/genproto/googleapis/api/label"
 	"google.golang.org/genproto/googleapis/api/metric"
 	"google.golang.org/genproto/googleapis/api/monitoredres"
 	"google.golang.org/genproto/googleapis/monitoring/v3"
 	"google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	st "google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 const bufSize = 1024 * 1024
@@ -42,13 +49,15 @@ var (
 	ctx        context.Context
 	grpcServer *grpc.Server
 	lis        *bufconn.Listener
+	mockServer *MockMetricServer
 )
 
-func setup() {
+func setup(opts ...Option) {
 	// Setup the in-memory server.
 	lis = bufconn.Listen(bufSize)
-	grpcServer = grpc.NewServer()
-	monitoring.RegisterMetricServiceServer(grpcServer, NewMockMetricServer())
+	mockServer = NewMockMetricServer(opts...)
+	grpcServer = grpc.NewServer(grpc.UnaryInterceptor(mockServer.UnaryInterceptor()))
+	monitoring.RegisterMetricServiceServer(grpcServer, mockServer)
 	go func() {
 		if err := grpcServer.Serve(lis); err != nil {
 			log.Fatalf("server exited with error: %v", err)
@@ -119,6 +128,336 @@ func TestMockMetricServer_ListTimeSeries(t *testing.T) {
 	}
 }
 
+func TestMockMetricServer_CreateAndListTimeSeries_RoundTrip(t *testing.T) {
+	setup()
+	defer tearDown()
+
+	point := &monitoring.Point{
+		Interval: &monitoring.TimeInterval{
+			EndTime: timestamppb.New(time.Unix(1000, 0)),
+		},
+		Value: &monitoring.TypedValue{
+			Value: &monitoring.TypedValue_DoubleValue{DoubleValue: 42},
+		},
+	}
+	series := &monitoring.TimeSeries{
+		Metric:   &metric.Metric{Type: "custom.googleapis.com/test", Labels: map[string]string{"env": "prod"}},
+		Resource: &monitoredres.MonitoredResource{Type: "global"},
+		Points:   []*monitoring.Point{point},
+	}
+
+	if _, err := client.CreateTimeSeries(ctx, &monitoring.CreateTimeSeriesRequest{
+		Name:       "test create time series request",
+		TimeSeries: []*monitoring.TimeSeries{series},
+	}); err != nil {
+		t.Fatalf("failed to call CreateTimeSeries: %v", err)
+	}
+
+	in := &monitoring.ListTimeSeriesRequest{
+		Name:     "test list time series request",
+		Filter:   `metric.type = "custom.googleapis.com/test" AND metric.labels.env = "prod"`,
+		Interval: &monitoring.TimeInterval{},
+		View:     monitoring.ListTimeSeriesRequest_FULL,
+	}
+	response, err := client.ListTimeSeries(ctx, in)
+	if err != nil {
+		t.Fatalf("failed to call ListTimeSeries: %v", err)
+	}
+
+	if len(response.GetTimeSeries()) != 1 {
+		t.Fatalf("ListTimeSeries(%q) returned %d series, want 1", in, len(response.GetTimeSeries()))
+	}
+	if got := response.GetTimeSeries()[0].GetPoints(); len(got) != 1 || !proto.Equal(got[0], point) {
+		t.Errorf("ListTimeSeries(%q) returned points %v, want %v", in, got, []*monitoring.Point{point})
+	}
+}
+
+func TestMockMetricServer_ListTimeSeries_HeadersViewStripsPoints(t *testing.T) {
+	setup()
+	defer tearDown()
+
+	series := &monitoring.TimeSeries{
+		Metric:   &metric.Metric{Type: "custom.googleapis.com/test-headers"},
+		Resource: &monitoredres.MonitoredResource{Type: "global"},
+		Points: []*monitoring.Point{{
+			Interval: &monitoring.TimeInterval{EndTime: timestamppb.New(time.Unix(1000, 0))},
+			Value:    &monitoring.TypedValue{Value: &monitoring.TypedValue_DoubleValue{DoubleValue: 1}},
+		}},
+	}
+	if _, err := client.CreateTimeSeries(ctx, &monitoring.CreateTimeSeriesRequest{
+		Name:       "test create time series request",
+		TimeSeries: []*monitoring.TimeSeries{series},
+	}); err != nil {
+		t.Fatalf("failed to call CreateTimeSeries: %v", err)
+	}
+
+	in := &monitoring.ListTimeSeriesRequest{
+		Name:     "test list time series request",
+		Filter:   `metric.type = "custom.googleapis.com/test-headers"`,
+		Interval: &monitoring.TimeInterval{},
+		View:     monitoring.ListTimeSeriesRequest_HEADERS,
+	}
+	response, err := client.ListTimeSeries(ctx, in)
+	if err != nil {
+		t.Fatalf("failed to call ListTimeSeries: %v", err)
+	}
+
+	if len(response.GetTimeSeries()) != 1 {
+		t.Fatalf("ListTimeSeries(%q) returned %d series, want 1", in, len(response.GetTimeSeries()))
+	}
+	if got := response.GetTimeSeries()[0].GetPoints(); len(got) != 0 {
+		t.Errorf("ListTimeSeries(%q) with HEADERS view returned points %v, want none", in, got)
+	}
+}
+
+func TestMockMetricServer_ListTimeSeries_Aggregation_AlignmentPeriod(t *testing.T) {
+	setup()
+	defer tearDown()
+
+	series := &monitoring.TimeSeries{
+		Metric:   &metric.Metric{Type: "custom.googleapis.com/test-align"},
+		Resource: &monitoredres.MonitoredResource{Type: "global"},
+		Points: []*monitoring.Point{
+			{
+				Interval: &monitoring.TimeInterval{EndTime: timestamppb.New(time.Unix(0, 0))},
+				Value:    &monitoring.TypedValue{Value: &monitoring.TypedValue_DoubleValue{DoubleValue: 1}},
+			},
+			{
+				Interval: &monitoring.TimeInterval{EndTime: timestamppb.New(time.Unix(30, 0))},
+				Value:    &monitoring.TypedValue{Value: &monitoring.TypedValue_DoubleValue{DoubleValue: 3}},
+			},
+			{
+				Interval: &monitoring.TimeInterval{EndTime: timestamppb.New(time.Unix(60, 0))},
+				Value:    &monitoring.TypedValue{Value: &monitoring.TypedValue_DoubleValue{DoubleValue: 5}},
+			},
+		},
+	}
+	if _, err := client.CreateTimeSeries(ctx, &monitoring.CreateTimeSeriesRequest{
+		Name:       "test create time series request",
+		TimeSeries: []*monitoring.TimeSeries{series},
+	}); err != nil {
+		t.Fatalf("failed to call CreateTimeSeries: %v", err)
+	}
+
+	in := &monitoring.ListTimeSeriesRequest{
+		Name:     "test list time series request",
+		Filter:   `metric.type = "custom.googleapis.com/test-align"`,
+		Interval: &monitoring.TimeInterval{},
+		View:     monitoring.ListTimeSeriesRequest_FULL,
+		Aggregation: &monitoring.Aggregation{
+			AlignmentPeriod:  durationpb.New(60 * time.Second),
+			PerSeriesAligner: monitoring.Aggregation_ALIGN_SUM,
+		},
+	}
+	response, err := client.ListTimeSeries(ctx, in)
+	if err != nil {
+		t.Fatalf("failed to call ListTimeSeries: %v", err)
+	}
+
+	if len(response.GetTimeSeries()) != 1 {
+		t.Fatalf("ListTimeSeries(%q) returned %d series, want 1", in, len(response.GetTimeSeries()))
+	}
+	if got := response.GetTimeSeries()[0].GetPoints(); len(got) != 2 {
+		t.Fatalf("ListTimeSeries(%q) returned %d aligned points, want 2", in, len(got))
+	}
+	if got := pointValue(response.GetTimeSeries()[0].GetPoints()[0]); got != 4 {
+		t.Errorf("ListTimeSeries(%q) first bucket = %v, want 4 (sum of the points at t=0 and t=30)", in, got)
+	}
+	if got := pointValue(response.GetTimeSeries()[0].GetPoints()[1]); got != 5 {
+		t.Errorf("ListTimeSeries(%q) second bucket = %v, want 5", in, got)
+	}
+}
+
+func TestMockMetricServer_ListTimeSeries_Aggregation_CrossSeriesReducer(t *testing.T) {
+	setup()
+	defer tearDown()
+
+	point := func(v float64) *monitoring.Point {
+		return &monitoring.Point{
+			Interval: &monitoring.TimeInterval{EndTime: timestamppb.New(time.Unix(1000, 0))},
+			Value:    &monitoring.TypedValue{Value: &monitoring.TypedValue_DoubleValue{DoubleValue: v}},
+		}
+	}
+	series := []*monitoring.TimeSeries{
+		{
+			Metric:   &metric.Metric{Type: "custom.googleapis.com/test-reduce", Labels: map[string]string{"zone": "us-east", "instance": "a"}},
+			Resource: &monitoredres.MonitoredResource{Type: "global", Labels: map[string]string{"zone": "us-east"}},
+			Points:   []*monitoring.Point{point(2)},
+		},
+		{
+			Metric:   &metric.Metric{Type: "custom.googleapis.com/test-reduce", Labels: map[string]string{"zone": "us-east", "instance": "b"}},
+			Resource: &monitoredres.MonitoredResource{Type: "global", Labels: map[string]string{"zone": "us-east"}},
+			Points:   []*monitoring.Point{point(4)},
+		},
+	}
+	if _, err := client.CreateTimeSeries(ctx, &monitoring.CreateTimeSeriesRequest{
+		Name:       "test create time series request",
+		TimeSeries: series,
+	}); err != nil {
+		t.Fatalf("failed to call CreateTimeSeries: %v", err)
+	}
+
+	in := &monitoring.ListTimeSeriesRequest{
+		Name:     "test list time series request",
+		Filter:   `metric.type = "custom.googleapis.com/test-reduce"`,
+		Interval: &monitoring.TimeInterval{},
+		View:     monitoring.ListTimeSeriesRequest_FULL,
+		Aggregation: &monitoring.Aggregation{
+			AlignmentPeriod:    durationpb.New(60 * time.Second),
+			PerSeriesAligner:   monitoring.Aggregation_ALIGN_SUM,
+			CrossSeriesReducer: monitoring.Aggregation_REDUCE_SUM,
+			GroupByFields:      []string{"resource.labels.zone"},
+		},
+	}
+	response, err := client.ListTimeSeries(ctx, in)
+	if err != nil {
+		t.Fatalf("failed to call ListTimeSeries: %v", err)
+	}
+
+	if len(response.GetTimeSeries()) != 1 {
+		t.Fatalf("ListTimeSeries(%q) returned %d series, want 1 (both inputs share zone=us-east)", in, len(response.GetTimeSeries()))
+	}
+	if got := response.GetTimeSeries()[0].GetPoints(); len(got) != 1 || pointValue(got[0]) != 6 {
+		t.Errorf("ListTimeSeries(%q) returned points %v, want a single point summing to 6", in, got)
+	}
+}
+
+func TestMockMetricServer_ListTimeSeries_Aggregation_CrossSeriesReducer_WithPagination(t *testing.T) {
+	setup(WithMaxPageSize(2))
+	defer tearDown()
+
+	point := func(v float64) *monitoring.Point {
+		return &monitoring.Point{
+			Interval: &monitoring.TimeInterval{EndTime: timestamppb.New(time.Unix(1000, 0))},
+			Value:    &monitoring.TypedValue{Value: &monitoring.TypedValue_DoubleValue{DoubleValue: v}},
+		}
+	}
+	series := []*monitoring.TimeSeries{
+		{
+			Metric:   &metric.Metric{Type: "custom.googleapis.com/test-reduce-paginated", Labels: map[string]string{"zone": "us-east", "instance": "a"}},
+			Resource: &monitoredres.MonitoredResource{Type: "global", Labels: map[string]string{"zone": "us-east"}},
+			Points:   []*monitoring.Point{point(1)},
+		},
+		{
+			Metric:   &metric.Metric{Type: "custom.googleapis.com/test-reduce-paginated", Labels: map[string]string{"zone": "us-east", "instance": "b"}},
+			Resource: &monitoredres.MonitoredResource{Type: "global", Labels: map[string]string{"zone": "us-east"}},
+			Points:   []*monitoring.Point{point(2)},
+		},
+		{
+			Metric:   &metric.Metric{Type: "custom.googleapis.com/test-reduce-paginated", Labels: map[string]string{"zone": "us-east", "instance": "c"}},
+			Resource: &monitoredres.MonitoredResource{Type: "global", Labels: map[string]string{"zone": "us-east"}},
+			Points:   []*monitoring.Point{point(4)},
+		},
+	}
+	if _, err := client.CreateTimeSeries(ctx, &monitoring.CreateTimeSeriesRequest{
+		Name:       "test create time series request",
+		TimeSeries: series,
+	}); err != nil {
+		t.Fatalf("failed to call CreateTimeSeries: %v", err)
+	}
+
+	in := &monitoring.ListTimeSeriesRequest{
+		Name:     "test list time series request",
+		Filter:   `metric.type = "custom.googleapis.com/test-reduce-paginated"`,
+		Interval: &monitoring.TimeInterval{},
+		View:     monitoring.ListTimeSeriesRequest_FULL,
+		Aggregation: &monitoring.Aggregation{
+			AlignmentPeriod:    durationpb.New(60 * time.Second),
+			PerSeriesAligner:   monitoring.Aggregation_ALIGN_SUM,
+			CrossSeriesReducer: monitoring.Aggregation_REDUCE_SUM,
+			GroupByFields:      []string{"resource.labels.zone"},
+		},
+	}
+	response, err := client.ListTimeSeries(ctx, in)
+	if err != nil {
+		t.Fatalf("failed to call ListTimeSeries: %v", err)
+	}
+
+	// The 3 series sharing zone=us-east must reduce to one series summing
+	// to 7 before pagination splits the result, even though the configured
+	// max page size (2) is smaller than the number of series that went in:
+	// pagination must operate on the post-aggregation series, not the
+	// pre-aggregation ones, or this group would come back split across
+	// pages as two partial sums instead.
+	if len(response.GetTimeSeries()) != 1 {
+		t.Fatalf("ListTimeSeries(%q) returned %d series, want 1 (all 3 inputs share zone=us-east and must reduce before pagination)", in, len(response.GetTimeSeries()))
+	}
+	if got := response.GetTimeSeries()[0].GetPoints(); len(got) != 1 || pointValue(got[0]) != 7 {
+		t.Errorf("ListTimeSeries(%q) returned points %v, want a single point summing to 7", in, got)
+	}
+	if response.GetNextPageToken() != "" {
+		t.Errorf("ListTimeSeries(%q) NextPageToken = %q, want empty (the single reduced series fits in one page)", in, response.GetNextPageToken())
+	}
+}
+
+func TestMockMetricServer_ListTimeSeries_Pagination(t *testing.T) {
+	setup(WithMaxPageSize(3))
+	defer tearDown()
+
+	const seeded = 10
+	want := make(map[string]struct{}, seeded)
+	for i := 0; i < seeded; i++ {
+		env := fmt.Sprintf("env-%02d", i)
+		want[env] = struct{}{}
+		series := &monitoring.TimeSeries{
+			Metric:   &metric.Metric{Type: "custom.googleapis.com/test-paginated", Labels: map[string]string{"env": env}},
+			Resource: &monitoredres.MonitoredResource{Type: "global"},
+			Points: []*monitoring.Point{{
+				Interval: &monitoring.TimeInterval{EndTime: timestamppb.New(time.Unix(1000, 0))},
+				Value:    &monitoring.TypedValue{Value: &monitoring.TypedValue_DoubleValue{DoubleValue: 1}},
+			}},
+		}
+		if _, err := client.CreateTimeSeries(ctx, &monitoring.CreateTimeSeriesRequest{
+			Name:       "test create time series request",
+			TimeSeries: []*monitoring.TimeSeries{series},
+		}); err != nil {
+			t.Fatalf("failed to seed time series %q: %v", env, err)
+		}
+	}
+
+	filter := `metric.type = "custom.googleapis.com/test-paginated"`
+	got := make(map[string]struct{}, seeded)
+	pageToken := ""
+	for pages := 0; ; pages++ {
+		if pages > seeded {
+			t.Fatalf("ListTimeSeries did not terminate after %d pages", pages)
+		}
+		response, err := client.ListTimeSeries(ctx, &monitoring.ListTimeSeriesRequest{
+			Name:      "test list time series request",
+			Filter:    filter,
+			Interval:  &monitoring.TimeInterval{},
+			View:      monitoring.ListTimeSeriesRequest_HEADERS,
+			PageToken: pageToken,
+		})
+		if err != nil {
+			t.Fatalf("failed to call ListTimeSeries: %v", err)
+		}
+		if len(response.GetTimeSeries()) > 3 {
+			t.Errorf("page %d returned %d series, want at most the configured max of 3", pages, len(response.GetTimeSeries()))
+		}
+		for _, ts := range response.GetTimeSeries() {
+			env := ts.GetMetric().GetLabels()["env"]
+			if _, dup := got[env]; dup {
+				t.Errorf("series %q returned more than once across pages", env)
+			}
+			got[env] = struct{}{}
+		}
+		if response.GetNextPageToken() == "" {
+			break
+		}
+		pageToken = response.GetNextPageToken()
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("paginated through %d series, want %d", len(got), len(want))
+	}
+	for env := range want {
+		if _, ok := got[env]; !ok {
+			t.Errorf("missing series %q after paginating through all pages", env)
+		}
+	}
+}
+
 func TestMockMetricServer_GetMonitoredResourceDescriptor(t *testing.T) {
 	setup()
 	defer tearDown()
@@ -157,6 +496,18 @@ func TestMockMetricServer_ListMonitoredResourceDescriptors(t *testing.T) {
 	}
 }
 
+// validMetricDescriptor returns a MetricDescriptor that satisfies
+// validation.ValidateMetricDescriptor, for tests whose focus isn't the
+// validity rules themselves.
+func validMetricDescriptor(name string) *metric.MetricDescriptor {
+	return &metric.MetricDescriptor{
+		Name:       name,
+		Type:       "custom.googleapis.com/" + name,
+		MetricKind: metric.MetricDescriptor_GAUGE,
+		ValueType:  metric.MetricDescriptor_INT64,
+	}
+}
+
 func TestMockMetricServer_GetMetricDescriptor(t *testing.T) {
 	setup()
 	defer tearDown()
@@ -164,15 +515,11 @@ func TestMockMetricServer_GetMetricDescriptor(t *testing.T) {
 	in := &monitoring.GetMetricDescriptorRequest{
 		Name: "test-metric-descriptor-1",
 	}
-	want := &metric.MetricDescriptor{
-		Name: "test-metric-descriptor-1",
-	}
+	want := validMetricDescriptor("test-metric-descriptor-1")
 
 	if _, err := client.CreateMetricDescriptor(ctx, &monitoring.CreateMetricDescriptorRequest{
-		Name: "test-metric-descriptor-1",
-		MetricDescriptor: &metric.MetricDescriptor{
-			Name: "test-metric-descriptor-1",
-		},
+		Name:             "test-metric-descriptor-1",
+		MetricDescriptor: want,
 	}); err != nil {
 		t.Fatalf("failed to create test metric descriptor with error: %v", err)
 	}
@@ -191,11 +538,11 @@ func TestMockMetricServer_CreateMetricDescriptor(t *testing.T) {
 	setup()
 	defer tearDown()
 
+	want := validMetricDescriptor("test-create-metric-descriptor")
 	in := &monitoring.CreateMetricDescriptorRequest{
 		Name:             "test create metric descriptor",
-		MetricDescriptor: &metric.MetricDescriptor{},
+		MetricDescriptor: want,
 	}
-	want := &metric.MetricDescriptor{}
 	response, err := client.CreateMetricDescriptor(ctx, in)
 	if err != nil {
 		t.Fatalf("failed to call CreateMetricDescriptor: %v", err)
@@ -206,6 +553,85 @@ func TestMockMetricServer_CreateMetricDescriptor(t *testing.T) {
 	}
 }
 
+func TestMockMetricServer_CreateMetricDescriptor_InvalidArgumentError(t *testing.T) {
+	setup()
+	defer tearDown()
+
+	tests := []struct {
+		name       string
+		descriptor *metric.MetricDescriptor
+		wantField  string
+	}{
+		{
+			name: "type missing slash",
+			descriptor: &metric.MetricDescriptor{
+				Type:       "nosuchslash",
+				MetricKind: metric.MetricDescriptor_GAUGE,
+				ValueType:  metric.MetricDescriptor_INT64,
+			},
+			wantField: "Type",
+		},
+		{
+			name: "unspecified metric kind",
+			descriptor: &metric.MetricDescriptor{
+				Type:      "custom.googleapis.com/unspecified-kind",
+				ValueType: metric.MetricDescriptor_INT64,
+			},
+			wantField: "MetricKind",
+		},
+		{
+			name: "distribution requires delta or cumulative",
+			descriptor: &metric.MetricDescriptor{
+				Type:       "custom.googleapis.com/bad-distribution",
+				MetricKind: metric.MetricDescriptor_GAUGE,
+				ValueType:  metric.MetricDescriptor_DISTRIBUTION,
+			},
+			wantField: "ValueType",
+		},
+		{
+			name: "string forbids cumulative",
+			descriptor: &metric.MetricDescriptor{
+				Type:       "custom.googleapis.com/bad-string",
+				MetricKind: metric.MetricDescriptor_CUMULATIVE,
+				ValueType:  metric.MetricDescriptor_STRING,
+			},
+			wantField: "ValueType",
+		},
+		{
+			name: "invalid label key",
+			descriptor: &metric.MetricDescriptor{
+				Type:       "custom.googleapis.com/bad-label",
+				MetricKind: metric.MetricDescriptor_GAUGE,
+				ValueType:  metric.MetricDescriptor_INT64,
+				Labels:     []*label.LabelDescriptor{{Key: "1-not-an-identifier"}},
+			},
+			wantField: "Labels",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			in := &monitoring.CreateMetricDescriptorRequest{
+				Name:             "test create metric descriptor",
+				MetricDescriptor: tc.descriptor,
+			}
+			response, err := client.CreateMetricDescriptor(ctx, in)
+			if err == nil {
+				t.Fatalf("CreateMetricDescriptor(%q) == %q, expected InvalidArgument error", in, response)
+			}
+
+			if s := st.Convert(err); s.Code() != validation.ErrInvalidMetricDescriptor.Code() {
+				t.Errorf("CreateMetricDescriptor(%q) returned error %q, expected code %q",
+					in, s.Message(), validation.ErrInvalidMetricDescriptor.Code())
+			}
+
+			if valid := validation.ValidateErrDetails(err, map[string]struct{}{tc.wantField: {}}); !valid {
+				t.Errorf("expected violation on field %q, got error %v", tc.wantField, err)
+			}
+		})
+	}
+}
+
 func TestMockMetricServer_DeleteMetricDescriptor(t *testing.T) {
 	setup()
 	defer tearDown()
@@ -216,10 +642,8 @@ func TestMockMetricServer_DeleteMetricDescriptor(t *testing.T) {
 	want := &empty.Empty{}
 
 	if _, err := client.CreateMetricDescriptor(ctx, &monitoring.CreateMetricDescriptorRequest{
-		Name: "test",
-		MetricDescriptor: &metric.MetricDescriptor{
-			Name: "test-metric-descriptor",
-		},
+		Name:             "test",
+		MetricDescriptor: validMetricDescriptor("test-metric-descriptor"),
 	}); err != nil {
 		t.Fatalf("failed to create test metric descriptor with error: %v", err)
 	}
@@ -254,6 +678,99 @@ func TestMockMetricServer_ListMetricDescriptors(t *testing.T) {
 	}
 }
 
+func TestMockMetricServer_ListMetricDescriptors_Pagination(t *testing.T) {
+	setup(WithMaxPageSize(3))
+	defer tearDown()
+
+	const seeded = 10
+	want := make(map[string]struct{}, seeded)
+	for i := 0; i < seeded; i++ {
+		name := fmt.Sprintf("test-paginated-descriptor-%02d", i)
+		want[name] = struct{}{}
+		if _, err := client.CreateMetricDescriptor(ctx, &monitoring.CreateMetricDescriptorRequest{
+			Name:             "test create metric descriptor",
+			MetricDescriptor: validMetricDescriptor(name),
+		}); err != nil {
+			t.Fatalf("failed to seed metric descriptor %q: %v", name, err)
+		}
+	}
+
+	got := make(map[string]struct{}, seeded)
+	pageToken := ""
+	for pages := 0; ; pages++ {
+		if pages > seeded {
+			t.Fatalf("ListMetricDescriptors did not terminate after %d pages", pages)
+		}
+		response, err := client.ListMetricDescriptors(ctx, &monitoring.ListMetricDescriptorsRequest{
+			Name:      "test list metric descriptors request",
+			PageToken: pageToken,
+		})
+		if err != nil {
+			t.Fatalf("failed to call ListMetricDescriptors: %v", err)
+		}
+		if len(response.GetMetricDescriptors()) > 3 {
+			t.Errorf("page %d returned %d descriptors, want at most the configured max of 3", pages, len(response.GetMetricDescriptors()))
+		}
+		for _, d := range response.GetMetricDescriptors() {
+			if _, dup := got[d.GetName()]; dup {
+				t.Errorf("descriptor %q returned more than once across pages", d.GetName())
+			}
+			got[d.GetName()] = struct{}{}
+		}
+		if response.GetNextPageToken() == "" {
+			break
+		}
+		pageToken = response.GetNextPageToken()
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("paginated through %d descriptors, want %d", len(got), len(want))
+	}
+	for name := range want {
+		if _, ok := got[name]; !ok {
+			t.Errorf("missing descriptor %q after paginating through all pages", name)
+		}
+	}
+}
+
+func TestMockMetricServer_ListMetricDescriptors_MismatchedFilterError(t *testing.T) {
+	setup(WithMaxPageSize(1))
+	defer tearDown()
+
+	for _, name := range []string{"test-mismatch-descriptor-1", "test-mismatch-descriptor-2"} {
+		if _, err := client.CreateMetricDescriptor(ctx, &monitoring.CreateMetricDescriptorRequest{
+			Name:             "test create metric descriptor",
+			MetricDescriptor: validMetricDescriptor(name),
+		}); err != nil {
+			t.Fatalf("failed to seed metric descriptor %q: %v", name, err)
+		}
+	}
+
+	first, err := client.ListMetricDescriptors(ctx, &monitoring.ListMetricDescriptorsRequest{
+		Name:   "test list metric descriptors request",
+		Filter: `metric.type = "a"`,
+	})
+	if err != nil {
+		t.Fatalf("failed to call ListMetricDescriptors: %v", err)
+	}
+	if first.GetNextPageToken() == "" {
+		t.Fatal("expected a NextPageToken from the first page")
+	}
+
+	in := &monitoring.ListMetricDescriptorsRequest{
+		Name:      "test list metric descriptors request",
+		Filter:    `metric.type = "b"`,
+		PageToken: first.GetNextPageToken(),
+	}
+	response, err := client.ListMetricDescriptors(ctx, in)
+	if err == nil {
+		t.Fatalf("ListMetricDescriptors(%q) == %q, expected InvalidArgument error for mismatched filter", in, response)
+	}
+	if s := st.Convert(err); s.Code() != codes.InvalidArgument {
+		t.Errorf("ListMetricDescriptors(%q) returned code %v, want %v", in, s.Code(), codes.InvalidArgument)
+	}
+}
+
 func TestMockMetricServer_GetMetricDescriptor_MissingFieldsError(t *testing.T) {
 	setup()
 	defer tearDown()
@@ -347,10 +864,10 @@ func TestMockMetricServer_MetricDescriptor_DataRace(t *testing.T) {
 		defer wg.Done()
 		_, err := client.CreateMetricDescriptor(ctx, &monitoring.CreateMetricDescriptorRequest{
 			Name:             "test-create-metric-descriptor",
-			MetricDescriptor: &metric.MetricDescriptor{Name: "test-metric-descriptor-1"},
+			MetricDescriptor: validMetricDescriptor("test-metric-descriptor-1"),
 		})
 		if err != nil {
-			t.Fatalf("failed to call CreateMetricDescriptor: %v", err)
+			t.Errorf("failed to call CreateMetricDescriptor: %v", err)
 		}
 	}()
 
@@ -358,10 +875,10 @@ func TestMockMetricServer_MetricDescriptor_DataRace(t *testing.T) {
 		defer wg.Done()
 		_, err := client.CreateMetricDescriptor(ctx, &monitoring.CreateMetricDescriptorRequest{
 			Name:             "test-create-metric-descriptor",
-			MetricDescriptor: &metric.MetricDescriptor{Name: "test-metric-descriptor-2"},
+			MetricDescriptor: validMetricDescriptor("test-metric-descriptor-2"),
 		})
 		if err != nil {
-			t.Fatalf("failed to call CreateMetricDescriptor: %v", err)
+			t.Errorf("failed to call CreateMetricDescriptor: %v", err)
 		}
 	}()
 
@@ -374,19 +891,15 @@ func TestMockMetricServer_DuplicateMetricDescriptorError(t *testing.T) {
 	duplicateSpanName := "test-metric-descriptor-1"
 
 	if _, err := client.CreateMetricDescriptor(ctx, &monitoring.CreateMetricDescriptorRequest{
-		Name: "test",
-		MetricDescriptor: &metric.MetricDescriptor{
-			Name: duplicateSpanName,
-		},
+		Name:             "test",
+		MetricDescriptor: validMetricDescriptor(duplicateSpanName),
 	}); err != nil {
 		t.Fatalf("failed to create test metric descriptor with error: %v", err)
 	}
 
 	in := &monitoring.CreateMetricDescriptorRequest{
-		Name: "test",
-		MetricDescriptor: &metric.MetricDescriptor{
-			Name: duplicateSpanName,
-		},
+		Name:             "test",
+		MetricDescriptor: validMetricDescriptor(duplicateSpanName),
 	}
 	want := validation.StatusDuplicateMetricDescriptorName
 	response, err := client.CreateMetricDescriptor(ctx, in)
@@ -400,6 +913,53 @@ func TestMockMetricServer_DuplicateMetricDescriptorError(t *testing.T) {
 
 }
 
+func TestMockMetricServer_DuplicateMetricDescriptorError_KindOrValueTypeChanged(t *testing.T) {
+	setup()
+	defer tearDown()
+	duplicateName := "test-metric-descriptor-changed"
+
+	if _, err := client.CreateMetricDescriptor(ctx, &monitoring.CreateMetricDescriptorRequest{
+		Name:             "test",
+		MetricDescriptor: validMetricDescriptor(duplicateName),
+	}); err != nil {
+		t.Fatalf("failed to create test metric descriptor with error: %v", err)
+	}
+
+	changed := validMetricDescriptor(duplicateName)
+	changed.MetricKind = metric.MetricDescriptor_CUMULATIVE
+	changed.ValueType = metric.MetricDescriptor_DISTRIBUTION
+
+	in := &monitoring.CreateMetricDescriptorRequest{
+		Name:             "test",
+		MetricDescriptor: changed,
+	}
+	response, err := client.CreateMetricDescriptor(ctx, in)
+	if err == nil {
+		t.Fatalf("CreateMetricDescriptor(%q) == %q, expected AlreadyExists error", in, response)
+	}
+
+	if valid := validation.ValidateDuplicateSpanNames(err, duplicateName); !valid {
+		t.Errorf("expected duplicate name: %v", duplicateName)
+	}
+	if valid := validation.ValidateDuplicateMetricDescriptorConfigChanged(err, duplicateName); !valid {
+		t.Errorf("CreateMetricDescriptor(%q) returned error %v, expected the MetricKind/ValueType-changed variant, not the plain duplicate-name one", in, err)
+	}
+
+	// A duplicate that keeps the same MetricKind/ValueType is still rejected,
+	// but via the plain duplicate-name error, not the changed-config one.
+	unchanged := &monitoring.CreateMetricDescriptorRequest{
+		Name:             "test",
+		MetricDescriptor: validMetricDescriptor(duplicateName),
+	}
+	_, err = client.CreateMetricDescriptor(ctx, unchanged)
+	if err == nil {
+		t.Fatalf("CreateMetricDescriptor(%q) == nil, expected AlreadyExists error", unchanged)
+	}
+	if valid := validation.ValidateDuplicateMetricDescriptorConfigChanged(err, duplicateName); valid {
+		t.Errorf("CreateMetricDescriptor(%q) returned the MetricKind/ValueType-changed error, want the plain duplicate-name one", unchanged)
+	}
+}
+
 func TestMockMetricServer_DeleteMetricDescriptor_MissingFieldsError(t *testing.T) {
 	setup()
 	defer tearDown()
@@ -494,7 +1054,7 @@ func TestMockMetricServer_ListTimeSeries_MissingFieldsError(t *testing.T) {
 
 	in := &monitoring.ListTimeSeriesRequest{}
 	want := validation.ErrMissingField.Err()
-	missingFields := map[string]struct{}{"Name": {}, "Filter": {}, "View": {}, "Interval": {}}
+	missingFields := map[string]struct{}{"Name": {}, "Filter": {}, "Interval": {}}
 	response, err := client.ListTimeSeries(ctx, in)
 	if err == nil {
 		t.Errorf("ListTimeSeries(%q) == %q, expected error %q", in, response, want)
@@ -510,6 +1070,93 @@ func TestMockMetricServer_ListTimeSeries_MissingFieldsError(t *testing.T) {
 	}
 }
 
+func TestMockMetricServer_FaultInjector_PermanentErrorIsNotRetried(t *testing.T) {
+	setup()
+	defer tearDown()
+
+	mockServer.Faults().SetNextError("CreateMetricDescriptor", st.New(codes.InvalidArgument, "injected permanent failure"), 1)
+
+	in := &monitoring.CreateMetricDescriptorRequest{
+		Name:             "test create metric descriptor",
+		MetricDescriptor: validMetricDescriptor("test-fault-injected"),
+	}
+
+	// A well-behaved client treats InvalidArgument as non-recoverable and
+	// does not retry, so the descriptor is never created and the handler is
+	// invoked exactly once.
+	response, err := client.CreateMetricDescriptor(ctx, in)
+	if err == nil {
+		t.Fatalf("CreateMetricDescriptor(%q) == %q, expected injected error", in, response)
+	}
+	if s := st.Convert(err); s.Code() != codes.InvalidArgument {
+		t.Errorf("CreateMetricDescriptor(%q) returned code %v, want %v", in, s.Code(), codes.InvalidArgument)
+	}
+
+	if got := mockServer.Faults().CallCount("CreateMetricDescriptor"); got != 1 {
+		t.Errorf("CreateMetricDescriptor call count == %d, want 1", got)
+	}
+}
+
+func TestMockMetricServer_FaultInjector_ErrorExpiresAfterCount(t *testing.T) {
+	setup()
+	defer tearDown()
+
+	mockServer.Faults().SetNextError("CreateMetricDescriptor", st.New(codes.Unavailable, "injected transient failure"), 1)
+
+	in := &monitoring.CreateMetricDescriptorRequest{
+		Name:             "test create metric descriptor",
+		MetricDescriptor: validMetricDescriptor("test-fault-retry"),
+	}
+
+	if _, err := client.CreateMetricDescriptor(ctx, in); err == nil {
+		t.Fatalf("CreateMetricDescriptor(%q) expected injected error on first call", in)
+	}
+
+	response, err := client.CreateMetricDescriptor(ctx, in)
+	if err != nil {
+		t.Fatalf("CreateMetricDescriptor(%q) failed on retry: %v", in, err)
+	}
+	if !proto.Equal(response, validMetricDescriptor("test-fault-retry")) {
+		t.Errorf("CreateMetricDescriptor(%q) == %q after retry, want the created descriptor", in, response)
+	}
+}
+
+func TestMockMetricServer_RequireAPIClientHeader_AcceptsTaggedClient(t *testing.T) {
+	setup(WithRequireAPIClientHeader())
+	defer tearDown()
+
+	tagged := metadata.AppendToOutgoingContext(ctx, "x-goog-api-client", "gl-go/1.16.0 gccl/0.1.0")
+	in := &monitoring.ListMetricDescriptorsRequest{Name: "test list metric descriptors request"}
+	if _, err := client.ListMetricDescriptors(tagged, in); err != nil {
+		t.Fatalf("ListMetricDescriptors(%q) with tagged client failed: %v", in, err)
+	}
+}
+
+func TestMockMetricServer_RequireAPIClientHeader_AcceptsTaggedClientNotFirstToken(t *testing.T) {
+	setup(WithRequireAPIClientHeader())
+	defer tearDown()
+
+	tagged := metadata.AppendToOutgoingContext(ctx, "x-goog-api-client", "grpc/1.31.0 gl-go/1.16.0")
+	in := &monitoring.ListMetricDescriptorsRequest{Name: "test list metric descriptors request"}
+	if _, err := client.ListMetricDescriptors(tagged, in); err != nil {
+		t.Fatalf("ListMetricDescriptors(%q) with tagged client failed: %v", in, err)
+	}
+}
+
+func TestMockMetricServer_RequireAPIClientHeader_RejectsStrippedClient(t *testing.T) {
+	setup(WithRequireAPIClientHeader())
+	defer tearDown()
+
+	in := &monitoring.ListMetricDescriptorsRequest{Name: "test list metric descriptors request"}
+	response, err := client.ListMetricDescriptors(ctx, in)
+	if err == nil {
+		t.Fatalf("ListMetricDescriptors(%q) == %q, expected FailedPrecondition error", in, response)
+	}
+	if s := st.Convert(err); s.Code() != codes.FailedPrecondition {
+		t.Errorf("ListMetricDescriptors(%q) returned code %v, want %v", in, s.Code(), codes.FailedPrecondition)
+	}
+}
+
 func TestMockMetricServer_CreateTimeSeries_MissingFieldsError(t *testing.T) {
 	setup()
 	defer tearDown()
@@ -0,0 +1,140 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	"github.com/googleinterns/cloud-operations-api-mock/internal/validation"
+)
+
+// defaultMaxPageSize is the page size List* handlers fall back to absent a
+// WithMaxPageSize option, and the ceiling a caller's requested page_size is
+// clamped to.
+const defaultMaxPageSize = 100
+
+// WithMaxPageSize overrides the default maximum (and fallback) page size
+// this server's List* handlers enforce.
+func WithMaxPageSize(n int32) Option {
+	return func(s *MockMetricServer) {
+		s.maxPageSize = n
+	}
+}
+
+// pageToken is the opaque cursor this mock encodes into NextPageToken. It
+// pins the last key already returned so the next call can resume after it,
+// and a hash of the filter that produced it so the server can reject a
+// caller that changes the filter mid-pagination.
+//
+// Real Monitoring encodes this as a proto; this mock has no protoc toolchain
+// available to generate one, so it uses the equivalent JSON shape instead.
+type pageToken struct {
+	LastKey    string `json:"last_key"`
+	FilterHash string `json:"filter_hash"`
+}
+
+func filterHash(filter string) string {
+	sum := sha256.Sum256([]byte(filter))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func encodePageToken(lastKey, filter string) string {
+	b, err := json.Marshal(pageToken{LastKey: lastKey, FilterHash: filterHash(filter)})
+	if err != nil {
+		return ""
+	}
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+func decodePageToken(token string) (*pageToken, error) {
+	if token == "" {
+		return nil, nil
+	}
+	b, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, validation.StatusInvalidPageToken.Err()
+	}
+	var pt pageToken
+	if err := json.Unmarshal(b, &pt); err != nil {
+		return nil, validation.StatusInvalidPageToken.Err()
+	}
+	return &pt, nil
+}
+
+// paginationState is the result of validating and decoding a List* request's
+// page_token against its filter.
+type paginationState struct {
+	// afterKey is the key immediately after which the page should resume;
+	// empty for the first page of a sequence.
+	afterKey string
+}
+
+// resolvePageToken decodes token, checking it was issued for the same
+// filter, and reports where the next page should resume.
+func resolvePageToken(token, filter string) (*paginationState, error) {
+	pt, err := decodePageToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if pt == nil {
+		return &paginationState{}, nil
+	}
+	if pt.FilterHash != filterHash(filter) {
+		return nil, validation.StatusMismatchedPageFilter.Err()
+	}
+	return &paginationState{afterKey: pt.LastKey}, nil
+}
+
+// paginate slices sortedKeys (already sorted ascending) to the page starting
+// after state.afterKey, clamped to at most pageSize entries (a non-positive
+// pageSize, or one above maxPageSize, becomes maxPageSize), returning that
+// page's keys and the NextPageToken for
+// the following call (empty once the sequence is exhausted).
+func paginate(sortedKeys []string, state *paginationState, pageSize, maxPageSize int32, filter string) ([]string, string) {
+	if maxPageSize <= 0 {
+		maxPageSize = defaultMaxPageSize
+	}
+	if pageSize <= 0 || pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	start := 0
+	if state.afterKey != "" {
+		idx := sort.SearchStrings(sortedKeys, state.afterKey)
+		start = idx
+		if idx < len(sortedKeys) && sortedKeys[idx] == state.afterKey {
+			start = idx + 1
+		}
+	}
+	if start > len(sortedKeys) {
+		start = len(sortedKeys)
+	}
+
+	end := start + int(pageSize)
+	if end > len(sortedKeys) {
+		end = len(sortedKeys)
+	}
+
+	page := sortedKeys[start:end]
+
+	nextToken := ""
+	if end < len(sortedKeys) {
+		nextToken = encodePageToken(page[len(page)-1], filter)
+	}
+	return page, nextToken
+}